@@ -0,0 +1,160 @@
+// Command trek runs SQL file migrations managed by the trek package against
+// a database.
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql" // mysql driver
+	_ "github.com/lib/pq"              // postgres driver
+
+	"github.com/ivancevich/trek"
+	"github.com/ivancevich/trek/sourcefs"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("trek", flag.ContinueOnError)
+	databaseURL := fs.String("database-url", "", "database connection string")
+	dir := fs.String("dir", "migrations", "directory containing migration SQL files")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	rest := fs.Args()
+	if len(rest) == 0 {
+		return errors.New("trek: expected a command: up, down, status, create, or force")
+	}
+	cmd, rest := rest[0], rest[1:]
+
+	switch cmd {
+	case trek.UP, trek.DOWN, "status":
+		return runMigrate(cmd, *databaseURL, *dir)
+	case "create":
+		if len(rest) == 0 {
+			return errors.New("trek create: expected a migration name")
+		}
+		return create(*dir, rest[0])
+	case "force":
+		if len(rest) == 0 {
+			return errors.New("trek force: expected a version")
+		}
+		version, err := strconv.ParseInt(rest[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("trek force: invalid version %q: %w", rest[0], err)
+		}
+		return force(*databaseURL, version)
+	default:
+		return fmt.Errorf("trek: unknown command %q", cmd)
+	}
+}
+
+func runMigrate(cmd, databaseURL, dir string) error {
+	db, kind, err := connect(databaseURL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := sourcefs.LoadFS(os.DirFS(dir), "."); err != nil {
+		return err
+	}
+
+	if cmd == "status" {
+		return printStatus(db, kind)
+	}
+
+	_, newVersion, err := trek.Run(db, kind, cmd)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("trek: migrated to version %d\n", newVersion)
+	return nil
+}
+
+func printStatus(db *sql.DB, kind string) error {
+	statuses, err := trek.Status(db, kind)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range statuses {
+		state := "pending"
+		if s.Applied {
+			state = "applied at " + s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Printf("%d\t%s\n", s.Version, state)
+	}
+	return nil
+}
+
+func force(databaseURL string, version int64) error {
+	db, kind, err := connect(databaseURL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := trek.Force(db, version, kind); err != nil {
+		return err
+	}
+	fmt.Printf("trek: forced version to %d\n", version)
+	return nil
+}
+
+// create scaffolds a new pair of up/down SQL files in dir, named after name
+// and timestamped so concurrent branches don't collide on the same version.
+func create(dir, name string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("%s_%s", time.Now().UTC().Format("20060102150405"), name))
+
+	for _, side := range []string{"up", "down"} {
+		path := base + "." + side + ".sql"
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("-- %s migration for %s\n", side, name)), 0o644); err != nil {
+			return err
+		}
+		fmt.Println(path)
+	}
+
+	return nil
+}
+
+// connect opens databaseURL and maps its scheme to the trek database kind
+// that selects the right driver.
+func connect(databaseURL string) (db *sql.DB, kind string, err error) {
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch u.Scheme {
+	case "postgres", "postgresql":
+		db, err = sql.Open("postgres", databaseURL)
+		kind = trek.POSTGRES
+	case "mysql":
+		db, err = sql.Open("mysql", strings.TrimPrefix(databaseURL, "mysql://"))
+		kind = trek.MYSQL
+	default:
+		err = fmt.Errorf("trek: unsupported database scheme %q", u.Scheme)
+	}
+
+	return
+}
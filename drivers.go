@@ -0,0 +1,251 @@
+package trek
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// execer is the subset of *sql.DB and *sql.Conn that a Driver needs to
+// create its bookkeeping table, read the current version, and take its
+// lock. Accepting this instead of *sql.DB lets RunContext/RunToContext pin a
+// single *sql.Conn for the whole lock-to-unlock window, so a session-scoped
+// lock (pg_advisory_lock, GET_LOCK) is acquired and released on the same
+// backend rather than on whichever connection the pool happens to hand out.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// Driver implements the database-specific behavior trek needs to manage its
+// bookkeeping table: creating it, reading and writing the current version,
+// taking the advisory lock used to serialize migrations, and formatting
+// placeholders for its SQL dialect. RegisterDriver lets callers add support
+// for a database trek doesn't ship a driver for, without patching this
+// package.
+type Driver interface {
+	CreateVersionTable(ctx context.Context, db execer) error
+	CurrentVersion(ctx context.Context, db execer) (int64, error)
+	SetVersion(ctx context.Context, tx *sql.Tx, version int64) error
+	Lock(ctx context.Context, db execer) error
+	// Unlock releases the advisory lock taken by Lock, reporting via
+	// released whether db's session actually held it. Session-scoped locks
+	// (pg_advisory_lock, GET_LOCK) are no-ops when released from a
+	// connection other than the one that took them, so released is what
+	// lets callers like UnlockContext tell a real release from a silent
+	// no-op.
+	Unlock(ctx context.Context, db execer) (released bool, err error)
+	Placeholder(n int) string
+	// SystemSchemas lists the information_schema-visible schema names that
+	// ship with the database engine itself, so SnapshotSchema can exclude
+	// them and leave only the schema migrations actually produced.
+	SystemSchemas() []string
+}
+
+var drivers = map[string]Driver{}
+
+// RegisterDriver registers a Driver under name, making it available through
+// the Database option (e.g. trek.Run(db, "sqlite3")). It panics if name is
+// already registered, mirroring database/sql.Register.
+func RegisterDriver(name string, d Driver) {
+	if _, ok := drivers[name]; ok {
+		panic(fmt.Sprintf("trek: driver %q already registered", name))
+	}
+	drivers[name] = d
+}
+
+func driverFor(name string) (Driver, error) {
+	d, ok := drivers[name]
+	if !ok {
+		return nil, errUnrecognizedDatabase
+	}
+	return d, nil
+}
+
+func init() {
+	RegisterDriver(POSTGRES, postgresDriver{})
+	RegisterDriver(MYSQL, mysqlDriver{})
+	RegisterDriver(SQLITE3, sqlite3Driver{})
+	RegisterDriver(COCKROACHDB, cockroachDBDriver{})
+}
+
+// lockKey identifies trek's advisory lock so migrations never run
+// concurrently against the same database, regardless of how many processes
+// call Run at once. It is an arbitrary fixed value, not derived from
+// anything about the schema.
+const lockKey int64 = 7335723803234
+
+// lockName is the MySQL equivalent of lockKey; GET_LOCK/RELEASE_LOCK take a
+// name rather than an integer.
+const lockName = "trek_migrations"
+
+// insertVersionQuery builds the INSERT statement SetVersion runs, so each
+// driver only has to supply its placeholder syntax via Placeholder instead
+// of duplicating the statement shape.
+func insertVersionQuery(d Driver) string {
+	return fmt.Sprintf(`INSERT INTO migrations (version) VALUES (%s)`, d.Placeholder(1))
+}
+
+type postgresDriver struct{}
+
+func (postgresDriver) CreateVersionTable(ctx context.Context, db execer) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS migrations (id SERIAL PRIMARY KEY, version BIGINT NOT NULL, created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW())`)
+	return err
+}
+
+func (postgresDriver) CurrentVersion(ctx context.Context, db execer) (currentVersion int64, err error) {
+	err = db.QueryRowContext(ctx, `SELECT version FROM migrations ORDER BY id DESC LIMIT 1`).Scan(&currentVersion)
+	if err == sql.ErrNoRows {
+		currentVersion = 0
+		err = nil
+	}
+	return
+}
+
+func (d postgresDriver) SetVersion(ctx context.Context, tx *sql.Tx, version int64) error {
+	_, err := tx.ExecContext(ctx, insertVersionQuery(d), version)
+	return err
+}
+
+func (postgresDriver) Lock(ctx context.Context, db execer) error {
+	_, err := db.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey)
+	return err
+}
+
+func (postgresDriver) Unlock(ctx context.Context, db execer) (released bool, err error) {
+	err = db.QueryRowContext(ctx, `SELECT pg_advisory_unlock($1)`, lockKey).Scan(&released)
+	return
+}
+
+func (postgresDriver) Placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+func (postgresDriver) SystemSchemas() []string {
+	return []string{"information_schema", "pg_catalog"}
+}
+
+type mysqlDriver struct{}
+
+func (mysqlDriver) CreateVersionTable(ctx context.Context, db execer) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS migrations (id BIGINT PRIMARY KEY AUTO_INCREMENT, version BIGINT NOT NULL, created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP)`)
+	return err
+}
+
+func (mysqlDriver) CurrentVersion(ctx context.Context, db execer) (currentVersion int64, err error) {
+	err = db.QueryRowContext(ctx, `SELECT version FROM migrations ORDER BY id DESC LIMIT 1`).Scan(&currentVersion)
+	if err == sql.ErrNoRows {
+		currentVersion = 0
+		err = nil
+	}
+	return
+}
+
+func (d mysqlDriver) SetVersion(ctx context.Context, tx *sql.Tx, version int64) error {
+	_, err := tx.ExecContext(ctx, insertVersionQuery(d), version)
+	return err
+}
+
+func (mysqlDriver) Lock(ctx context.Context, db execer) error {
+	_, err := db.ExecContext(ctx, `SELECT GET_LOCK(?, -1)`, lockName)
+	return err
+}
+
+func (mysqlDriver) Unlock(ctx context.Context, db execer) (released bool, err error) {
+	// RELEASE_LOCK returns 1 if this session held and released the lock, 0
+	// if some other session holds it, and NULL if the lock doesn't exist.
+	var result sql.NullInt64
+	if err = db.QueryRowContext(ctx, `SELECT RELEASE_LOCK(?)`, lockName).Scan(&result); err != nil {
+		return
+	}
+	released = result.Valid && result.Int64 == 1
+	return
+}
+
+func (mysqlDriver) Placeholder(n int) string {
+	return "?"
+}
+
+func (mysqlDriver) SystemSchemas() []string {
+	return []string{"information_schema", "mysql", "sys", "performance_schema"}
+}
+
+// sqlite3Driver supports the mattn/go-sqlite3 and modernc.org/sqlite
+// drivers. SQLite has no cross-connection advisory lock primitive, so Lock
+// and Unlock are no-ops; callers running migrations from multiple processes
+// against the same SQLite file need to serialize access themselves.
+type sqlite3Driver struct{}
+
+func (sqlite3Driver) CreateVersionTable(ctx context.Context, db execer) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS migrations (id INTEGER PRIMARY KEY AUTOINCREMENT, version BIGINT NOT NULL, created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP)`)
+	return err
+}
+
+func (sqlite3Driver) CurrentVersion(ctx context.Context, db execer) (currentVersion int64, err error) {
+	err = db.QueryRowContext(ctx, `SELECT version FROM migrations ORDER BY id DESC LIMIT 1`).Scan(&currentVersion)
+	if err == sql.ErrNoRows {
+		currentVersion = 0
+		err = nil
+	}
+	return
+}
+
+func (d sqlite3Driver) SetVersion(ctx context.Context, tx *sql.Tx, version int64) error {
+	_, err := tx.ExecContext(ctx, insertVersionQuery(d), version)
+	return err
+}
+
+func (sqlite3Driver) Lock(ctx context.Context, db execer) error { return nil }
+func (sqlite3Driver) Unlock(ctx context.Context, db execer) (released bool, err error) {
+	return false, nil
+}
+
+func (sqlite3Driver) Placeholder(n int) string {
+	return "?"
+}
+
+// SystemSchemas returns nil because SQLite has no information_schema to
+// speak of; SnapshotSchema will simply find no system schemas to exclude.
+func (sqlite3Driver) SystemSchemas() []string {
+	return nil
+}
+
+// cockroachDBDriver reuses Postgres' wire protocol and SQL dialect.
+// CockroachDB does not implement pg_advisory_lock/pg_advisory_unlock, so
+// Lock and Unlock are no-ops; its transaction retry semantics make trek's
+// cooperative lock less necessary than on Postgres.
+type cockroachDBDriver struct{}
+
+func (cockroachDBDriver) CreateVersionTable(ctx context.Context, db execer) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS migrations (id SERIAL PRIMARY KEY, version BIGINT NOT NULL, created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW())`)
+	return err
+}
+
+func (cockroachDBDriver) CurrentVersion(ctx context.Context, db execer) (currentVersion int64, err error) {
+	err = db.QueryRowContext(ctx, `SELECT version FROM migrations ORDER BY id DESC LIMIT 1`).Scan(&currentVersion)
+	if err == sql.ErrNoRows {
+		currentVersion = 0
+		err = nil
+	}
+	return
+}
+
+func (d cockroachDBDriver) SetVersion(ctx context.Context, tx *sql.Tx, version int64) error {
+	_, err := tx.ExecContext(ctx, insertVersionQuery(d), version)
+	return err
+}
+
+func (cockroachDBDriver) Lock(ctx context.Context, db execer) error { return nil }
+func (cockroachDBDriver) Unlock(ctx context.Context, db execer) (released bool, err error) {
+	return false, nil
+}
+
+func (cockroachDBDriver) Placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+func (cockroachDBDriver) SystemSchemas() []string {
+	return []string{"information_schema", "pg_catalog", "crdb_internal", "pg_extension"}
+}
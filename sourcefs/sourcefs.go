@@ -0,0 +1,99 @@
+// Package sourcefs loads SQL file migrations from a directory or embed.FS
+// and registers them with trek, so callers don't have to hand-write Go
+// registration code for every migration.
+package sourcefs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/ivancevich/trek"
+)
+
+var filenamePattern = regexp.MustCompile(`^(\d+)_([^.]+)\.(up|down)\.sql$`)
+
+// LoadFS scans dir within fsys for files named "{version}_{name}.up.sql"
+// and "{version}_{name}.down.sql" and registers each matched version as a
+// migration, using the SQL files' contents as the migration's Up and Down
+// steps and the filename's name segment as the migration's Name. A version
+// without a down file rolls back without running any SQL. A version without
+// an up file has no Up step, so trek's up migrations skip it and never record
+// its version. fsys can be an embed.FS or os.DirFS(".") for a plain
+// directory.
+func LoadFS(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	type files struct {
+		name, up, down string
+	}
+	byVersion := map[int64]*files{}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := filenamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("sourcefs: invalid version in %q: %w", entry.Name(), err)
+		}
+
+		contents, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		if byVersion[version] == nil {
+			byVersion[version] = &files{name: match[2]}
+		}
+
+		switch match[3] {
+		case "up":
+			byVersion[version].up = string(contents)
+		case "down":
+			byVersion[version].down = string(contents)
+		}
+	}
+
+	versions := make([]int64, 0, len(byVersion))
+	for version := range byVersion {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	for _, version := range versions {
+		f := byVersion[version]
+		if err := trek.RegisterNamed(version, f.name, queryHandler(f.up), queryHandler(f.down)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// queryHandler returns a migration handler that executes query inside the
+// migration's transaction. It returns nil for an empty query, leaving the
+// corresponding side of the migration without a handler.
+func queryHandler(query string) func(context.Context, *sql.Tx) error {
+	if query == "" {
+		return nil
+	}
+	return func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, query)
+		return err
+	}
+}
@@ -0,0 +1,37 @@
+package sourcefs
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/20240115093000_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INT)")},
+		"migrations/20240115093000_create_users.down.sql": {Data: []byte("DROP TABLE users")},
+		"migrations/20240116101500_add_email.up.sql":      {Data: []byte("ALTER TABLE users ADD email TEXT")},
+		"migrations/README.md":                            {Data: []byte("not a migration")},
+	}
+
+	if err := LoadFS(fsys, "migrations"); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestLoadFSSkipsNonMigrationFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/not-a-version_broken.up.sql": {Data: []byte("SELECT 1")},
+	}
+
+	if err := LoadFS(fsys, "migrations"); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestLoadFSMissingDir(t *testing.T) {
+	fsys := fstest.MapFS{}
+
+	if err := LoadFS(fsys, "missing"); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+}
@@ -1,18 +1,23 @@
 package trek
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var (
-	migrations                   []migration
-	errUnrecognizedDatabase      = errors.New("trek: unrecognized database")
-	errUnrecognizedAction        = errors.New("trek: unrecognized action")
-	errPreviousMigrationNotFound = errors.New("trek: previous migration not found")
-	errVersionAlreadyRegistered  = errors.New("trek: version already registered")
-	errMigrationAlreadyRunning   = errors.New("trek: migration already running")
+	migrations                     []migration
+	errUnrecognizedDatabase        = errors.New("trek: unrecognized database")
+	errUnrecognizedAction          = errors.New("trek: unrecognized action")
+	errPreviousMigrationNotFound   = errors.New("trek: previous migration not found")
+	errVersionAlreadyRegistered    = errors.New("trek: version already registered")
+	errLegacyHandlerNeedsMoreConns = errors.New("trek: db must allow more than one open connection to run migrations registered through Register; see Register's doc comment")
 )
 
 const (
@@ -24,43 +29,457 @@ const (
 	POSTGRES = "postgres"
 	// MYSQL is a supported database
 	MYSQL = "mysql"
+	// SQLITE3 is a supported database
+	SQLITE3 = "sqlite3"
+	// COCKROACHDB is a supported database
+	COCKROACHDB = "cockroachdb"
 )
 
-// Register adds migrations to be run
-func Register(version int64, up, down migrationHandler) error {
+// dbContextKey is the context key used to recover the *sql.DB passed to
+// RunContext from within an adapted legacy handler.
+type dbContextKey struct{}
+
+// legacyHandler is the migration function signature used before context and
+// per-migration transactions were introduced. It is kept around so existing
+// migrations registered through Register keep compiling unmodified.
+//
+// legacyHandler's *sql.DB can't be backed by the migration's *sql.Tx, so
+// migrations registered through Register are NOT transactional: if up
+// commits some changes and then returns an error, those changes stay in
+// place even though the recorded version does not advance. Migrations that
+// need the transactional guarantee should be registered through
+// RegisterContext instead.
+//
+// Because a legacyHandler checks out its own connection from the pool
+// rather than reusing RunContext's pinned one, db must allow at least two
+// open connections when any migration registered through Register might
+// run; RunContext reports errLegacyHandlerNeedsMoreConns up front instead of
+// deadlocking if db is limited to one.
+type legacyHandler func(*sql.DB) error
+
+// migrationHandler is the function signature migrations implement. It runs
+// inside its own transaction and receives a context for cancellation and
+// deadline propagation.
+type migrationHandler func(context.Context, *sql.Tx) error
+
+// adapt turns a legacyHandler into a migrationHandler so both kinds can be
+// stored and executed the same way. The *sql.DB it needs is recovered from
+// the context set up by RunContext; as a result, adapted handlers run
+// against the database directly rather than inside the migration's
+// transaction, so they don't get the transactional guarantee that
+// migrationHandler has.
+func adapt(fn legacyHandler) migrationHandler {
+	if fn == nil {
+		return nil
+	}
+	return func(ctx context.Context, tx *sql.Tx) error {
+		db, _ := ctx.Value(dbContextKey{}).(*sql.DB)
+		return fn(db)
+	}
+}
+
+// Register adds migrations to be run using the legacy *sql.DB-based handler
+// signature. These handlers are not transactional; see legacyHandler. Prefer
+// RegisterContext for new migrations. A legacy handler checks out its own
+// connection from db's pool while the run holds another, so once any
+// migration is registered through Register, Run and RunTo return an error
+// if db is limited to a single open connection.
+func Register(version int64, up, down legacyHandler) error {
+	return register(version, "", adapt(up), adapt(down), true)
+}
+
+// RegisterContext adds context and transaction aware migrations to be run
+func RegisterContext(version int64, up, down migrationHandler) error {
+	return register(version, "", up, down, false)
+}
+
+// RegisterNamed adds a context and transaction aware migration to be run,
+// recording name alongside its version so Status and similar tooling have
+// something more useful to display than a bare number.
+func RegisterNamed(version int64, name string, up, down migrationHandler) error {
+	return register(version, name, up, down, false)
+}
+
+// RegisterAt registers a migration under a version derived from t instead
+// of a developer-assigned integer, formatted as the RFC3339-like timestamp
+// YYYYMMDDHHMMSS. Two developers on different branches independently
+// picking "version 5" is how errVersionAlreadyRegistered gets hit at merge
+// time; picking versions from the clock instead makes collisions virtually
+// impossible.
+func RegisterAt(t time.Time, name string, up, down migrationHandler) error {
+	version, err := strconv.ParseInt(t.UTC().Format("20060102150405"), 10, 64)
+	if err != nil {
+		return err
+	}
+	return register(version, name, up, down, false)
+}
+
+func register(version int64, name string, up, down migrationHandler, legacy bool) error {
 	if versionAlreadyRegistered(version) {
 		return errVersionAlreadyRegistered
 	}
 	migrations = append(migrations, migration{
 		Version: version,
+		Name:    name,
 		Up:      up,
 		Down:    down,
+		Legacy:  legacy,
 	})
 	return nil
 }
 
+// hasLegacyMigrations reports whether any migration was registered through
+// Register, meaning its handlers need a second pool connection alongside
+// RunContext's pinned one.
+func hasLegacyMigrations() bool {
+	for _, m := range migrations {
+		if m.Legacy {
+			return true
+		}
+	}
+	return false
+}
+
 // Run executes database migrations
 func Run(db *sql.DB, options ...string) (didChange bool, newVersion int64, err error) {
+	return RunContext(context.Background(), db, options...)
+}
+
+// RunContext executes database migrations, propagating ctx for cancellation
+// and deadlines. Each migration runs inside its own transaction, so a failed
+// migration leaves no half-written bookkeeping behind — except migrations
+// registered through the legacy Register, which are not transactional; see
+// legacyHandler. An advisory lock is held for the duration of the run so two
+// processes never migrate the same database at once; the run pins a single
+// *sql.Conn for the lock, the migrations, and the unlock, since a
+// session-scoped lock acquired on one pool connection can't be released from
+// another. If any migration was registered through Register, db must allow
+// a second open connection for its legacy handler to use; RunContext returns
+// errLegacyHandlerNeedsMoreConns instead of deadlocking if it doesn't.
+func RunContext(ctx context.Context, db *sql.DB, options ...string) (didChange bool, newVersion int64, err error) {
 	if len(migrations) == 0 {
 		return
 	}
 
+	if hasLegacyMigrations() && db.Stats().MaxOpenConnections == 1 {
+		err = errLegacyHandlerNeedsMoreConns
+		return
+	}
+
 	sort.Sort(byVersion(migrations))
 
+	config := parseOptions(options)
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	dtbs := &database{conn, config}
+	ctx = context.WithValue(ctx, dbContextKey{}, db)
+
+	if err = lock(ctx, dtbs); err != nil {
+		return
+	}
+	defer unlock(ctx, dtbs)
+
+	err = createTable(ctx, dtbs)
+	if err != nil {
+		return
+	}
+
+	oldVersion, err := getVersion(ctx, dtbs)
+	if err != nil {
+		return
+	}
+
+	newVersion, err = runMigrations(ctx, dtbs, oldVersion)
+	didChange = oldVersion != newVersion
+	return
+}
+
+// Force manually records version as the database's current migration
+// version, without running any migrations. It is an escape hatch for
+// operators recovering from a crashed process that left the recorded
+// version out of sync with what was actually applied.
+func Force(db *sql.DB, version int64, options ...string) error {
+	return ForceContext(context.Background(), db, version, options...)
+}
+
+// ForceContext is the context-aware variant of Force.
+func ForceContext(ctx context.Context, db *sql.DB, version int64, options ...string) error {
 	config := parseOptions(options)
 	dtbs := &database{db, config}
 
-	err = createTable(dtbs)
+	if err := createTable(ctx, dtbs); err != nil {
+		return err
+	}
+
+	tx, err := dtbs.BeginTx(ctx, nil)
 	if err != nil {
+		return err
+	}
+
+	if err = setVersion(ctx, tx, config, version); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Unlock releases trek's advisory lock. It exists for operators to recover
+// when a crashed process left the lock held by a connection that is no
+// longer around. Because db here is a fresh pool connection rather than the
+// one that took the lock, released reports whether anything was actually
+// released rather than just whether the query ran: a session-scoped lock
+// (pg_advisory_lock, GET_LOCK) can only be released by the session that took
+// it, so calling Unlock against the still-live connection that holds the
+// lock, or against a driver whose lock is a no-op to begin with, reports
+// released=false even though err is nil.
+func Unlock(db *sql.DB, options ...string) (released bool, err error) {
+	return UnlockContext(context.Background(), db, options...)
+}
+
+// UnlockContext is the context-aware variant of Unlock.
+func UnlockContext(ctx context.Context, db *sql.DB, options ...string) (released bool, err error) {
+	config := parseOptions(options)
+	return unlock(ctx, &database{db, config})
+}
+
+// MigrationStatus describes a registered migration's state against a
+// database, as reported by Status.
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Status reports, for every registered migration, whether it has been
+// applied to db and when.
+func Status(db *sql.DB, options ...string) ([]MigrationStatus, error) {
+	return StatusContext(context.Background(), db, options...)
+}
+
+// StatusContext is the context-aware variant of Status.
+func StatusContext(ctx context.Context, db *sql.DB, options ...string) ([]MigrationStatus, error) {
+	sort.Sort(byVersion(migrations))
+
+	config := parseOptions(options)
+	dtbs := &database{db, config}
+
+	if err := createTable(ctx, dtbs); err != nil {
+		return nil, err
+	}
+
+	currentVersion, err := getVersion(ctx, dtbs)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedVersions(ctx, dtbs)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		// applied is an append-only log of every version ever recorded, so a
+		// version that was later rolled back is still in it; gate Applied on
+		// the current version instead of log membership.
+		isApplied := m.Version <= currentVersion
+		appliedAt := time.Time{}
+		if isApplied {
+			appliedAt = applied[m.Version]
+		}
+		statuses[i] = MigrationStatus{
+			Version:   m.Version,
+			Name:      m.Name,
+			Applied:   isApplied,
+			AppliedAt: appliedAt,
+		}
+	}
+
+	return statuses, nil
+}
+
+// ErrVersionMismatch reports that a database's current migration version
+// does not match the highest version registered in the running process, as
+// returned by CheckVersion.
+type ErrVersionMismatch struct {
+	Expected int64
+	Actual   int64
+}
+
+func (e *ErrVersionMismatch) Error() string {
+	return fmt.Sprintf("trek: database is at version %d, expected %d", e.Actual, e.Expected)
+}
+
+// CheckVersion verifies that db's current migration version matches the
+// highest registered migration version, returning an *ErrVersionMismatch if
+// not. Services can call this at startup to fail fast rather than run
+// against a schema their migrations don't account for.
+func CheckVersion(db *sql.DB, options ...string) error {
+	return CheckVersionContext(context.Background(), db, options...)
+}
+
+// CheckVersionContext is the context-aware variant of CheckVersion.
+func CheckVersionContext(ctx context.Context, db *sql.DB, options ...string) error {
+	sort.Sort(byVersion(migrations))
+
+	config := parseOptions(options)
+	dtbs := &database{db, config}
+
+	if err := createTable(ctx, dtbs); err != nil {
+		return err
+	}
+
+	currentVersion, err := getVersion(ctx, dtbs)
+	if err != nil {
+		return err
+	}
+
+	if expected := latestVersion(); currentVersion != expected {
+		return &ErrVersionMismatch{Expected: expected, Actual: currentVersion}
+	}
+
+	return nil
+}
+
+// SnapshotSchema dumps db's information_schema columns into a stable,
+// textual representation ordered by table name and column position, suitable
+// for diffing against a golden file to catch drift between migrations and
+// the schema they actually produced. System schemas that ship with the
+// database engine itself (e.g. information_schema, MySQL's mysql/sys) are
+// excluded based on the Database option, which defaults to POSTGRES like the
+// other options-based functions.
+func SnapshotSchema(db *sql.DB, options ...string) (string, error) {
+	return SnapshotSchemaContext(context.Background(), db, options...)
+}
+
+// SnapshotSchemaContext is the context-aware variant of SnapshotSchema.
+func SnapshotSchemaContext(ctx context.Context, db *sql.DB, options ...string) (string, error) {
+	config := parseOptions(options)
+	d, err := driverFor(config.Database)
+	if err != nil {
+		return "", err
+	}
+
+	query := `SELECT table_name, column_name, data_type, is_nullable FROM information_schema.columns`
+
+	var args []interface{}
+	if systemSchemas := d.SystemSchemas(); len(systemSchemas) > 0 {
+		placeholders := make([]string, len(systemSchemas))
+		args = make([]interface{}, len(systemSchemas))
+		for i, schema := range systemSchemas {
+			placeholders[i] = d.Placeholder(i + 1)
+			args[i] = schema
+		}
+		query += fmt.Sprintf(` WHERE table_schema NOT IN (%s)`, strings.Join(placeholders, ", "))
+	}
+	query += ` ORDER BY table_name, ordinal_position`
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var b strings.Builder
+	for rows.Next() {
+		var table, column, dataType, nullable string
+		if err := rows.Scan(&table, &column, &dataType, &nullable); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s.%s %s nullable=%s\n", table, column, dataType, nullable)
+	}
+
+	return b.String(), rows.Err()
+}
+
+func appliedVersions(ctx context.Context, db *database) (map[int64]time.Time, error) {
+	rows, err := db.QueryContext(ctx, `SELECT version, created_at FROM migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var createdAt time.Time
+		if err := rows.Scan(&version, &createdAt); err != nil {
+			return nil, err
+		}
+		applied[version] = createdAt
+	}
+
+	return applied, rows.Err()
+}
+
+// RunTo migrates the database to targetVersion, stepping up or down through
+// the registered migrations as needed. Unlike Run, which only goes to the
+// latest version or one step back, RunTo supports multi-step rollbacks and
+// forward jumps through the same code path. If targetVersion is not a
+// registered version, the database ends at the highest registered version
+// below it (or 0) rather than at targetVersion itself.
+func RunTo(db *sql.DB, targetVersion int64, options ...string) (didChange bool, newVersion int64, err error) {
+	return RunToContext(context.Background(), db, targetVersion, options...)
+}
+
+// RunToContext is the context-aware variant of RunTo. Like RunContext, it
+// pins a single *sql.Conn for the lock, the migrations, and the unlock, and
+// requires a second open connection if any migration was registered through
+// Register; see RunContext.
+func RunToContext(ctx context.Context, db *sql.DB, targetVersion int64, options ...string) (didChange bool, newVersion int64, err error) {
+	if len(migrations) == 0 {
+		return
+	}
+
+	if hasLegacyMigrations() && db.Stats().MaxOpenConnections == 1 {
+		err = errLegacyHandlerNeedsMoreConns
+		return
+	}
+
+	sort.Sort(byVersion(migrations))
+
+	config := parseOptions(options)
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	dtbs := &database{conn, config}
+	ctx = context.WithValue(ctx, dbContextKey{}, db)
+
+	if err = lock(ctx, dtbs); err != nil {
 		return
 	}
+	defer unlock(ctx, dtbs)
 
-	oldVersion, err := getVersion(dtbs)
+	err = createTable(ctx, dtbs)
 	if err != nil {
 		return
 	}
 
-	newVersion, err = runMigrations(dtbs, oldVersion)
+	oldVersion, err := getVersion(ctx, dtbs)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case targetVersion > oldVersion:
+		newVersion, err = runUpTo(ctx, dtbs, oldVersion, targetVersion)
+	case targetVersion < oldVersion:
+		newVersion, err = runDownTo(ctx, dtbs, oldVersion, targetVersion)
+	default:
+		newVersion = oldVersion
+	}
+
 	didChange = oldVersion != newVersion
 	return
 }
@@ -70,60 +489,66 @@ func parseOptions(options []string) *configuration {
 
 	for _, opt := range options {
 		switch opt {
-		case UP:
-		case DOWN:
+		case UP, DOWN:
 			config.Action = opt
-			break
-		case POSTGRES:
-		case MYSQL:
+		case POSTGRES, MYSQL, SQLITE3, COCKROACHDB:
 			config.Database = opt
-			break
+		default:
+			if _, ok := drivers[opt]; ok {
+				config.Database = opt
+			}
 		}
 	}
 
 	return &config
 }
 
-func createTable(db *database) error {
-	var query string
+func createTable(ctx context.Context, db *database) error {
+	d, err := driverFor(db.Database)
+	if err != nil {
+		return err
+	}
+	return d.CreateVersionTable(ctx, db)
+}
 
-	switch db.Database {
-	case POSTGRES:
-		query = `CREATE TABLE IF NOT EXISTS migrations (id SERIAL PRIMARY KEY, version BIGINT NOT NULL, running BOOLEAN DEFAULT TRUE, created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW())`
-		break
-	case MYSQL:
-		query = `CREATE TABLE IF NOT EXISTS migrations (id BIGINT PRIMARY KEY AUTO_INCREMENT, version BIGINT NOT NULL, running BOOLEAN DEFAULT TRUE, created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP)`
-		break
-	default:
-		return errUnrecognizedDatabase
+// lock acquires a database-native advisory lock so only one process runs
+// migrations against this database at a time. Unlike the old running flag
+// this replaced, the lock is tied to the connection rather than a row, so a
+// crashed process can no longer leave migrations permanently stuck. db must
+// wrap a *sql.Conn pinned for the duration of the run: session-scoped locks
+// like pg_advisory_lock/GET_LOCK are only released by the backend that
+// acquired them, so Lock and Unlock have to run on the same connection.
+func lock(ctx context.Context, db *database) error {
+	d, err := driverFor(db.Database)
+	if err != nil {
+		return err
 	}
+	return d.Lock(ctx, db)
+}
 
-	_, err := db.Exec(query)
-	return err
+func unlock(ctx context.Context, db *database) (released bool, err error) {
+	d, err := driverFor(db.Database)
+	if err != nil {
+		return false, err
+	}
+	return d.Unlock(ctx, db)
 }
 
-func getVersion(db *database) (currentVersion int64, err error) {
-	var running bool
-	if err = db.QueryRow(`SELECT version, running FROM migrations ORDER BY id DESC LIMIT 1`).Scan(&currentVersion, &running); err != nil {
-		if err == sql.ErrNoRows {
-			currentVersion = 0
-			err = nil
-		}
+func getVersion(ctx context.Context, db *database) (currentVersion int64, err error) {
+	d, err := driverFor(db.Database)
+	if err != nil {
 		return
 	}
-	if running {
-		err = errMigrationAlreadyRunning
-	}
-	return
+	return d.CurrentVersion(ctx, db)
 }
 
-func runMigrations(db *database, oldVersion int64) (newVersion int64, err error) {
+func runMigrations(ctx context.Context, db *database, oldVersion int64) (newVersion int64, err error) {
 	switch db.Action {
 	case UP:
-		newVersion, err = runUp(db, oldVersion)
+		newVersion, err = runUp(ctx, db, oldVersion)
 		break
 	case DOWN:
-		newVersion, err = runDown(db, oldVersion)
+		newVersion, err = runDown(ctx, db, oldVersion)
 		break
 	default:
 		err = errUnrecognizedAction
@@ -132,39 +557,15 @@ func runMigrations(db *database, oldVersion int64) (newVersion int64, err error)
 	return
 }
 
-func runUp(db *database, oldVersion int64) (newVersion int64, err error) {
-	newVersion = oldVersion
-
-	for _, m := range migrations {
-		if m.Version <= oldVersion || m.Up == nil {
-			continue
-		}
-
-		if err = setVersion(db, m.Version, true); err != nil {
-			return
-		}
-
-		if err = m.Up(db.DB); err != nil {
-			return
-		}
-
-		if err = setVersion(db, m.Version, false); err != nil {
-			return
-		}
-
-		newVersion = m.Version
-	}
-
-	return
+func runUp(ctx context.Context, db *database, oldVersion int64) (newVersion int64, err error) {
+	return runUpTo(ctx, db, oldVersion, latestVersion())
 }
 
-func runDown(db *database, oldVersion int64) (newVersion int64, err error) {
+func runDown(ctx context.Context, db *database, oldVersion int64) (newVersion int64, err error) {
 	if oldVersion == 0 {
 		return
 	}
 
-	newVersion = oldVersion
-
 	var m *migration
 	for i := len(migrations) - 1; i >= 0; i-- {
 		if migrations[i].Version <= oldVersion {
@@ -174,49 +575,123 @@ func runDown(db *database, oldVersion int64) (newVersion int64, err error) {
 	}
 
 	if m == nil {
+		newVersion = oldVersion
 		err = errPreviousMigrationNotFound
 		return
 	}
 
-	if err = setVersion(db, m.Version-1, true); err != nil {
-		return
+	return runDownTo(ctx, db, oldVersion, previousVersion(m.Version))
+}
+
+// latestVersion returns the highest registered migration version, or 0 if
+// none are registered. migrations must already be sorted.
+func latestVersion() int64 {
+	if len(migrations) == 0 {
+		return 0
 	}
+	return migrations[len(migrations)-1].Version
+}
 
-	if m.Down != nil {
-		if err = m.Down(db.DB); err != nil {
-			return
+// previousVersion returns the highest registered version below version, or 0
+// if version is the lowest registered migration. Unlike version-1, this
+// stays correct for sparse versions such as the RFC3339-style timestamps
+// RegisterAt produces. migrations must already be sorted.
+func previousVersion(version int64) int64 {
+	prev := int64(0)
+	for _, m := range migrations {
+		if m.Version >= version {
+			break
 		}
+		prev = m.Version
 	}
+	return prev
+}
 
-	if err = setVersion(db, m.Version-1, false); err != nil {
-		return
+// runUpTo applies every registered migration greater than oldVersion and up
+// to and including targetVersion, in ascending order.
+func runUpTo(ctx context.Context, db *database, oldVersion, targetVersion int64) (newVersion int64, err error) {
+	newVersion = oldVersion
+
+	for _, m := range migrations {
+		if m.Version <= oldVersion || m.Version > targetVersion || m.Up == nil {
+			continue
+		}
+
+		if err = runMigration(ctx, db, m.Version, m.Up); err != nil {
+			return
+		}
+
+		newVersion = m.Version
 	}
 
-	newVersion = m.Version - 1
 	return
 }
 
-func setVersion(db *database, version int64, running bool) error {
-	var query string
+// runDownTo reverts migrations one step at a time until the recorded version
+// reaches targetVersion, reusing the same single-step logic Run(DOWN) uses
+// so single-step and multi-step rollbacks share one code path. Each step
+// records the previously registered version rather than version-1, so this
+// stays correct for sparse versions (gaps between integers, or RegisterAt's
+// timestamp-derived versions).
+func runDownTo(ctx context.Context, db *database, oldVersion, targetVersion int64) (newVersion int64, err error) {
+	newVersion = oldVersion
 
-	switch db.Database {
-	case POSTGRES:
-		query = `INSERT INTO migrations (version, running) VALUES ($1, $2)`
-		break
-	case MYSQL:
-		query = `INSERT INTO migrations (version, running) VALUES (?, ?)`
-		break
-	default:
-		return errUnrecognizedDatabase
+	for newVersion > targetVersion {
+		var m *migration
+		for i := len(migrations) - 1; i >= 0; i-- {
+			if migrations[i].Version <= newVersion {
+				m = &migrations[i]
+				break
+			}
+		}
+
+		if m == nil {
+			err = errPreviousMigrationNotFound
+			return
+		}
+
+		prev := previousVersion(m.Version)
+		if err = runMigration(ctx, db, prev, m.Down); err != nil {
+			return
+		}
+
+		newVersion = prev
 	}
 
-	stmt, err := db.Prepare(query)
+	return
+}
+
+// runMigration executes a single migration inside its own transaction. The
+// recorded version is written as part of that same transaction, so a
+// migration that returns an error rolls back cleanly and leaves the
+// previous version in place.
+func runMigration(ctx context.Context, db *database, version int64, handler migrationHandler) error {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 
-	_, err = stmt.Exec(version, running)
-	return err
+	if handler != nil {
+		if err = handler(ctx, tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err = setVersion(ctx, tx, db.configuration, version); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func setVersion(ctx context.Context, tx *sql.Tx, config *configuration, version int64) error {
+	d, err := driverFor(config.Database)
+	if err != nil {
+		return err
+	}
+	return d.SetVersion(ctx, tx, version)
 }
 
 func versionAlreadyRegistered(version int64) bool {
@@ -228,22 +703,25 @@ func versionAlreadyRegistered(version int64) bool {
 	return false
 }
 
-type migrationHandler func(*sql.DB) error
-
 type configuration struct {
 	Action   string
 	Database string
 }
 
+// database pairs an execer (a plain *sql.DB for operations that don't care
+// which pool connection they land on, or a *sql.Conn pinned for the
+// lock/run/unlock window) with the run's parsed configuration.
 type database struct {
-	*sql.DB
+	execer
 	*configuration
 }
 
 type migration struct {
 	Version int64
+	Name    string
 	Up      migrationHandler
 	Down    migrationHandler
+	Legacy  bool
 }
 
 type byVersion []migration
@@ -252,4 +730,7 @@ func (s byVersion) Len() int { return len(s) }
 
 func (s byVersion) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 
+// Less compares versions as plain int64s, so it stays correct whether
+// versions are small developer-assigned integers or sparse RFC3339-style
+// timestamps from RegisterAt.
 func (s byVersion) Less(i, j int) bool { return s[i].Version < s[j].Version }
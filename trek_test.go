@@ -1,16 +1,20 @@
 package trek
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	_ "github.com/go-sql-driver/mysql" // mysql driver
 	_ "github.com/lib/pq"              // postgres driver
+	_ "github.com/mattn/go-sqlite3"    // sqlite3 driver
 	"testing"
+	"time"
 )
 
 func connect(t *testing.T, kind string) (db *sql.DB) {
 	var err error
 
+	driverName := kind
 	var options string
 	switch kind {
 	case POSTGRES:
@@ -19,17 +23,34 @@ func connect(t *testing.T, kind string) (db *sql.DB) {
 	case MYSQL:
 		options = "root:@/trek"
 		break
+	case SQLITE3:
+		options = ":memory:"
+		break
+	case COCKROACHDB:
+		// CockroachDB speaks the Postgres wire protocol; database/sql has no
+		// driver registered under "cockroachdb", so we open it through
+		// lib/pq the way any CockroachDB client would.
+		driverName = POSTGRES
+		options = "user=root dbname=trek sslmode=disable port=26257"
+		break
 	default:
 		t.Error("Unsupported database kind")
 		return
 	}
 
-	db, err = sql.Open(kind, options)
+	db, err = sql.Open(driverName, options)
 	if err != nil {
 		t.Errorf("Error connecting to %s", kind)
 		return
 	}
 
+	if kind == SQLITE3 {
+		// Each connection to ":memory:" is its own independent database, so
+		// the pool has to be pinned to one connection for every test to see
+		// the same data.
+		db.SetMaxOpenConns(1)
+	}
+
 	err = db.Ping()
 	if err != nil {
 		t.Error("Error pinging the database")
@@ -90,12 +111,44 @@ func TestParseOptionsCustomValues2(t *testing.T) {
 	}
 }
 
+func TestSystemSchemasScopedPerDriver(t *testing.T) {
+	defer teardown(t, nil)
+	postgres, err := driverFor(POSTGRES)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	for _, schema := range []string{"mysql", "sys", "performance_schema"} {
+		for _, excluded := range postgres.SystemSchemas() {
+			if excluded == schema {
+				t.Errorf("Expected postgres's system schemas not to include MySQL's %q", schema)
+			}
+		}
+	}
+
+	mysql, err := driverFor(MYSQL)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	for _, want := range []string{"information_schema", "mysql", "sys", "performance_schema"} {
+		found := false
+		for _, excluded := range mysql.SystemSchemas() {
+			if excluded == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("Expected mysql's system schemas to include %q", want)
+		}
+	}
+}
+
 func TestCreateTableError(t *testing.T) {
 	db := connect(t, POSTGRES)
 	defer teardown(t, db)
 	config := &configuration{Database: "foo", Action: DOWN}
 	dtbs := &database{db, config}
-	err := createTable(dtbs)
+	err := createTable(context.Background(), dtbs)
 	if err == nil {
 		t.Error("Error expected")
 	}
@@ -109,7 +162,7 @@ func TestCreateTablePostgres(t *testing.T) {
 	defer teardown(t, db)
 	config := &configuration{Database: POSTGRES, Action: UP}
 	dtbs := &database{db, config}
-	err := createTable(dtbs)
+	err := createTable(context.Background(), dtbs)
 	if err != nil {
 		t.Error(err.Error())
 	}
@@ -124,7 +177,7 @@ func TestCreateTableMysql(t *testing.T) {
 	defer teardown(t, db)
 	config := &configuration{Database: MYSQL, Action: UP}
 	dtbs := &database{db, config}
-	err := createTable(dtbs)
+	err := createTable(context.Background(), dtbs)
 	if err != nil {
 		t.Error(err.Error())
 	}
@@ -134,16 +187,34 @@ func TestCreateTableMysql(t *testing.T) {
 	}
 }
 
+func TestCreateTableSqlite3(t *testing.T) {
+	db := connect(t, SQLITE3)
+	defer teardown(t, db)
+	config := &configuration{Database: SQLITE3, Action: UP}
+	dtbs := &database{db, config}
+	err := createTable(context.Background(), dtbs)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	rows, err := db.Query(`SELECT * FROM migrations`)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	// db is pinned to a single connection (see connect), so an unclosed
+	// *sql.Rows here would starve every later query on this test's db.
+	rows.Close()
+}
+
 func TestGetVersion0(t *testing.T) {
 	db := connect(t, POSTGRES)
 	defer teardown(t, db)
 	config := &configuration{Database: POSTGRES, Action: UP}
 	dtbs := &database{db, config}
-	err := createTable(dtbs)
+	err := createTable(context.Background(), dtbs)
 	if err != nil {
 		t.Error(err.Error())
 	}
-	currentVersion, err := getVersion(dtbs)
+	currentVersion, err := getVersion(context.Background(), dtbs)
 	if err != nil {
 		t.Error(err.Error())
 	}
@@ -157,15 +228,15 @@ func TestGetVersion1(t *testing.T) {
 	defer teardown(t, db)
 	config := &configuration{Database: POSTGRES, Action: UP}
 	dtbs := &database{db, config}
-	err := createTable(dtbs)
+	err := createTable(context.Background(), dtbs)
 	if err != nil {
 		t.Error(err.Error())
 	}
-	_, err = db.Exec(`INSERT INTO migrations (version, running) VALUES (1, false)`)
+	_, err = db.Exec(`INSERT INTO migrations (version) VALUES (1)`)
 	if err != nil {
 		t.Error(err.Error())
 	}
-	currentVersion, err := getVersion(dtbs)
+	currentVersion, err := getVersion(context.Background(), dtbs)
 	if err != nil {
 		t.Error(err.Error())
 	}
@@ -174,25 +245,111 @@ func TestGetVersion1(t *testing.T) {
 	}
 }
 
-func TestGetVersionError(t *testing.T) {
+func TestLockPostgres(t *testing.T) {
+	db := connect(t, POSTGRES)
+	defer teardown(t, db)
+	config := &configuration{Database: POSTGRES, Action: UP}
+	dtbs := &database{db, config}
+	if err := lock(context.Background(), dtbs); err != nil {
+		t.Error(err.Error())
+	}
+	released, err := unlock(context.Background(), dtbs)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if !released {
+		t.Error("Expected the lock to be released")
+	}
+}
+
+func TestLockMysql(t *testing.T) {
+	db := connect(t, MYSQL)
+	defer teardown(t, db)
+	config := &configuration{Database: MYSQL, Action: UP}
+	dtbs := &database{db, config}
+	if err := lock(context.Background(), dtbs); err != nil {
+		t.Error(err.Error())
+	}
+	released, err := unlock(context.Background(), dtbs)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if !released {
+		t.Error("Expected the lock to be released")
+	}
+}
+
+func TestUnlockPostgresNotHeld(t *testing.T) {
 	db := connect(t, POSTGRES)
 	defer teardown(t, db)
 	config := &configuration{Database: POSTGRES, Action: UP}
 	dtbs := &database{db, config}
-	err := createTable(dtbs)
+
+	// Nobody holds the lock here, so unlocking it must report that nothing
+	// was released rather than silently succeeding.
+	released, err := unlock(context.Background(), dtbs)
 	if err != nil {
 		t.Error(err.Error())
 	}
-	_, err = db.Exec(`INSERT INTO migrations (version, running) VALUES (1, true)`)
+	if released {
+		t.Error("Expected nothing to be released")
+	}
+}
+
+func TestLockSqlite3(t *testing.T) {
+	db := connect(t, SQLITE3)
+	defer teardown(t, db)
+	config := &configuration{Database: SQLITE3, Action: UP}
+	dtbs := &database{db, config}
+	if err := lock(context.Background(), dtbs); err != nil {
+		t.Error(err.Error())
+	}
+	released, err := unlock(context.Background(), dtbs)
 	if err != nil {
 		t.Error(err.Error())
 	}
-	_, err = getVersion(dtbs)
+	if released {
+		t.Error("Expected SQLite's no-op Unlock to report nothing released")
+	}
+}
+
+func TestLockError(t *testing.T) {
+	db := connect(t, POSTGRES)
+	defer teardown(t, db)
+	config := &configuration{Database: "foo", Action: UP}
+	dtbs := &database{db, config}
+	err := lock(context.Background(), dtbs)
 	if err == nil {
-		t.Error("Expected already running migration error")
+		t.Error("Error expected")
 	}
-	if err != errMigrationAlreadyRunning {
-		t.Error("Expected already running migration error")
+	if err != errUnrecognizedDatabase {
+		t.Error("Unrecognized database was expected")
+	}
+}
+
+func TestForce(t *testing.T) {
+	db := connect(t, POSTGRES)
+	defer teardown(t, db)
+	err := Force(db, 9, POSTGRES)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	config := &configuration{Database: POSTGRES, Action: UP}
+	currentVersion, err := getVersion(context.Background(), &database{db, config})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if currentVersion != 9 {
+		t.Error("Expected version to be 9")
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	db := connect(t, POSTGRES)
+	defer teardown(t, db)
+	_, err := Unlock(db, POSTGRES)
+	if err != nil {
+		t.Error(err.Error())
 	}
 }
 
@@ -229,12 +386,61 @@ func TestRegisterDuplicates(t *testing.T) {
 	}
 }
 
+func TestRunLegacyHandlerNeedsMoreConns(t *testing.T) {
+	db := connect(t, SQLITE3) // single-connection pool, no live server needed
+	defer teardown(t, db)
+	var up = func(*sql.DB) error { return nil }
+	var down = func(*sql.DB) error { return nil }
+	if err := Register(1, up, down); err != nil {
+		t.Error(err.Error())
+	}
+
+	_, _, err := Run(db, SQLITE3)
+	if err != errLegacyHandlerNeedsMoreConns {
+		t.Errorf("Expected errLegacyHandlerNeedsMoreConns, got %v", err)
+	}
+}
+
+func TestRegisterNamed(t *testing.T) {
+	defer teardown(t, nil)
+	var up = func(context.Context, *sql.Tx) error { return nil }
+	var down = func(context.Context, *sql.Tx) error { return nil }
+	err := RegisterNamed(1, "create_users", up, down)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if migrations[0].Name != "create_users" {
+		t.Error("Expected migration to have name equal to create_users")
+	}
+}
+
+func TestRegisterAt(t *testing.T) {
+	defer teardown(t, nil)
+	var up = func(context.Context, *sql.Tx) error { return nil }
+	var down = func(context.Context, *sql.Tx) error { return nil }
+	at := time.Date(2024, time.January, 15, 9, 30, 0, 0, time.UTC)
+	err := RegisterAt(at, "create_users", up, down)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if migrations[0].Version != 20240115093000 {
+		t.Error("Expected version derived from the timestamp")
+	}
+	if migrations[0].Name != "create_users" {
+		t.Error("Expected migration to have name equal to create_users")
+	}
+}
+
 func TestSetVersionError(t *testing.T) {
 	db := connect(t, POSTGRES)
 	defer teardown(t, db)
 	config := &configuration{Database: "foo", Action: UP}
-	dtbs := &database{db, config}
-	err := setVersion(dtbs, 9, false)
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	defer tx.Rollback()
+	err = setVersion(context.Background(), tx, config, 9)
 	if err == nil {
 		t.Error("Expected unrecognized database error")
 	}
@@ -248,7 +454,7 @@ func TestRunMigrationsError(t *testing.T) {
 	defer teardown(t, db)
 	config := &configuration{Database: POSTGRES, Action: "foo"}
 	dtbs := &database{db, config}
-	newVersion, err := runMigrations(dtbs, 0)
+	newVersion, err := runMigrations(context.Background(), dtbs, 0)
 	if newVersion != 0 {
 		t.Error("Expected new version to be 0")
 	}
@@ -281,8 +487,8 @@ func TestRunPostgresUp(t *testing.T) {
 	migrations = []migration{
 		{
 			Version: 1,
-			Up:      func(*sql.DB) error { return nil },
-			Down:    func(*sql.DB) error { return nil },
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
 		},
 	}
 	didChange, newVersion, err := Run(db, POSTGRES, UP)
@@ -303,8 +509,8 @@ func TestRunPostgresDown(t *testing.T) {
 	migrations = []migration{
 		{
 			Version: 1,
-			Up:      func(*sql.DB) error { return nil },
-			Down:    func(*sql.DB) error { return nil },
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
 		},
 	}
 	Run(db, POSTGRES, UP) // migrate to version 1
@@ -326,8 +532,8 @@ func TestRunMysqlUp(t *testing.T) {
 	migrations = []migration{
 		{
 			Version: 1,
-			Up:      func(*sql.DB) error { return nil },
-			Down:    func(*sql.DB) error { return nil },
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
 		},
 	}
 	didChange, newVersion, err := Run(db, MYSQL, UP)
@@ -348,8 +554,8 @@ func TestRunMysqlDown(t *testing.T) {
 	migrations = []migration{
 		{
 			Version: 1,
-			Up:      func(*sql.DB) error { return nil },
-			Down:    func(*sql.DB) error { return nil },
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
 		},
 	}
 	Run(db, MYSQL, UP) // migrate to version 1
@@ -365,14 +571,132 @@ func TestRunMysqlDown(t *testing.T) {
 	}
 }
 
+func TestRunSqlite3Up(t *testing.T) {
+	db := connect(t, SQLITE3)
+	defer teardown(t, db)
+	migrations = []migration{
+		{
+			Version: 1,
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
+		},
+	}
+	didChange, newVersion, err := Run(db, SQLITE3, UP)
+	if !didChange {
+		t.Error("Expected to change version")
+	}
+	if newVersion != 1 {
+		t.Error("Expected new version to be 1")
+	}
+	if err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestRunSqlite3Down(t *testing.T) {
+	db := connect(t, SQLITE3)
+	defer teardown(t, db)
+	migrations = []migration{
+		{
+			Version: 1,
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
+		},
+	}
+	Run(db, SQLITE3, UP) // migrate to version 1
+	didChange, newVersion, err := Run(db, SQLITE3, DOWN)
+	if !didChange {
+		t.Error("Expected to change version")
+	}
+	if newVersion != 0 {
+		t.Error("Expected new version to be 0")
+	}
+	if err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestCreateTableCockroachDB(t *testing.T) {
+	db := connect(t, COCKROACHDB)
+	defer teardown(t, db)
+	config := &configuration{Database: COCKROACHDB, Action: UP}
+	dtbs := &database{db, config}
+	err := createTable(context.Background(), dtbs)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	_, err = db.Query(`SELECT * FROM migrations`)
+	if err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestLockCockroachDB(t *testing.T) {
+	db := connect(t, COCKROACHDB)
+	defer teardown(t, db)
+	config := &configuration{Database: COCKROACHDB, Action: UP}
+	dtbs := &database{db, config}
+	if err := lock(context.Background(), dtbs); err != nil {
+		t.Error(err.Error())
+	}
+	if _, err := unlock(context.Background(), dtbs); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestRunCockroachDBUp(t *testing.T) {
+	db := connect(t, COCKROACHDB)
+	defer teardown(t, db)
+	migrations = []migration{
+		{
+			Version: 1,
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
+		},
+	}
+	didChange, newVersion, err := Run(db, COCKROACHDB, UP)
+	if !didChange {
+		t.Error("Expected to change version")
+	}
+	if newVersion != 1 {
+		t.Error("Expected new version to be 1")
+	}
+	if err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestRunCockroachDBDown(t *testing.T) {
+	db := connect(t, COCKROACHDB)
+	defer teardown(t, db)
+	migrations = []migration{
+		{
+			Version: 1,
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
+		},
+	}
+	Run(db, COCKROACHDB, UP) // migrate to version 1
+	didChange, newVersion, err := Run(db, COCKROACHDB, DOWN)
+	if !didChange {
+		t.Error("Expected to change version")
+	}
+	if newVersion != 0 {
+		t.Error("Expected new version to be 0")
+	}
+	if err != nil {
+		t.Error(err.Error())
+	}
+}
+
 func TestRunUpSameVersion(t *testing.T) {
 	db := connect(t, POSTGRES)
 	defer teardown(t, db)
 	migrations = []migration{
 		{
 			Version: 1,
-			Up:      func(*sql.DB) error { return nil },
-			Down:    func(*sql.DB) error { return nil },
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
 		},
 	}
 	Run(db, POSTGRES, UP)                               // migrate to version 1
@@ -394,8 +718,8 @@ func TestRunDownSameVersion(t *testing.T) {
 	migrations = []migration{
 		{
 			Version: 1,
-			Up:      func(*sql.DB) error { return nil },
-			Down:    func(*sql.DB) error { return nil },
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
 		},
 	}
 	Run(db, POSTGRES, UP)                                 // migrate to version 1
@@ -418,13 +742,13 @@ func TestRunUpWithError(t *testing.T) {
 	migrations = []migration{
 		{
 			Version: 1,
-			Up:      func(*sql.DB) error { return nil },
-			Down:    func(*sql.DB) error { return nil },
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
 		},
 		{
 			Version: 2,
-			Up:      func(*sql.DB) error { return errors.New("Foo") },
-			Down:    func(*sql.DB) error { return nil },
+			Up:      func(context.Context, *sql.Tx) error { return errors.New("Foo") },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
 		},
 	}
 	didChange, newVersion, err := Run(db, POSTGRES, UP)
@@ -448,13 +772,13 @@ func TestRunDownWithError(t *testing.T) {
 	migrations = []migration{
 		{
 			Version: 2,
-			Up:      func(*sql.DB) error { return nil },
-			Down:    func(*sql.DB) error { return errors.New("Foo") },
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return errors.New("Foo") },
 		},
 		{
 			Version: 1,
-			Up:      func(*sql.DB) error { return nil },
-			Down:    func(*sql.DB) error { return nil },
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
 		},
 	}
 	Run(db, POSTGRES, UP) // migrate to version 2
@@ -479,16 +803,16 @@ func TestRunDownWithoutMigration(t *testing.T) {
 	migrations = []migration{
 		{
 			Version: 1,
-			Up:      func(*sql.DB) error { return nil },
-			Down:    func(*sql.DB) error { return nil },
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
 		},
 	}
 	Run(db, POSTGRES, UP) // migrate to version 1
 	migrations = []migration{
 		{
 			Version: 2,
-			Up:      func(*sql.DB) error { return nil },
-			Down:    func(*sql.DB) error { return nil },
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
 		},
 	}
 	didChange, newVersion, err := Run(db, POSTGRES, DOWN)
@@ -505,3 +829,293 @@ func TestRunDownWithoutMigration(t *testing.T) {
 		t.Error("Expected previous migration error")
 	}
 }
+
+func TestStatus(t *testing.T) {
+	db := connect(t, POSTGRES)
+	defer teardown(t, db)
+	migrations = []migration{
+		{
+			Version: 1,
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
+		},
+		{
+			Version: 2,
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
+		},
+	}
+	didChange, _, err := RunTo(db, 1, POSTGRES)
+	if !didChange {
+		t.Error("Expected to change version")
+	}
+	if err != nil {
+		t.Error(err.Error())
+	}
+
+	statuses, err := Status(db, POSTGRES)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if len(statuses) != 2 {
+		t.Error("Expected two statuses")
+	}
+	if !statuses[0].Applied {
+		t.Error("Expected version 1 to be applied")
+	}
+	if statuses[0].AppliedAt.IsZero() {
+		t.Error("Expected version 1 to have an applied timestamp")
+	}
+	if statuses[1].Applied {
+		t.Error("Expected version 2 to be pending")
+	}
+}
+
+func TestStatusAfterRollback(t *testing.T) {
+	db := connect(t, POSTGRES)
+	defer teardown(t, db)
+	migrations = []migration{
+		{
+			Version: 1,
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
+		},
+		{
+			Version: 2,
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
+		},
+		{
+			Version: 3,
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
+		},
+	}
+	RunTo(db, 3, POSTGRES) // migrate to version 3
+	if _, _, err := RunTo(db, 1, POSTGRES); err != nil {
+		t.Error(err.Error())
+	}
+
+	// Versions 2 and 3 were both recorded by the up migration (and 2 again by
+	// the rollback), so appliedVersions still has entries for them; Status must
+	// not report them as applied just because they were once recorded.
+	statuses, err := Status(db, POSTGRES)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if !statuses[0].Applied {
+		t.Error("Expected version 1 to remain applied")
+	}
+	if statuses[1].Applied {
+		t.Error("Expected version 2 to be reported as rolled back, not applied")
+	}
+	if statuses[2].Applied {
+		t.Error("Expected version 3 to be reported as rolled back, not applied")
+	}
+}
+
+func TestRegisterAtRollback(t *testing.T) {
+	db := connect(t, POSTGRES)
+	defer teardown(t, db)
+	first := time.Date(2024, time.January, 15, 9, 30, 0, 0, time.UTC)
+	second := time.Date(2024, time.January, 16, 10, 15, 0, 0, time.UTC)
+	noop := func(context.Context, *sql.Tx) error { return nil }
+	if err := RegisterAt(first, "create_users", noop, noop); err != nil {
+		t.Error(err.Error())
+	}
+	if err := RegisterAt(second, "add_email", noop, noop); err != nil {
+		t.Error(err.Error())
+	}
+
+	if _, _, err := Run(db, POSTGRES); err != nil {
+		t.Error(err.Error())
+	}
+
+	// Rolling back one step from the second timestamp version must land
+	// exactly on the first timestamp version, not second.Version-1.
+	didChange, newVersion, err := Run(db, POSTGRES, DOWN)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if !didChange {
+		t.Error("Expected to change version")
+	}
+	if newVersion != migrations[0].Version {
+		t.Errorf("Expected rollback to land on %d, got %d", migrations[0].Version, newVersion)
+	}
+}
+
+func TestCheckVersionMatch(t *testing.T) {
+	db := connect(t, POSTGRES)
+	defer teardown(t, db)
+	migrations = []migration{
+		{
+			Version: 1,
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
+		},
+	}
+	if _, _, err := Run(db, POSTGRES); err != nil {
+		t.Error(err.Error())
+	}
+
+	if err := CheckVersion(db, POSTGRES); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestCheckVersionMismatch(t *testing.T) {
+	db := connect(t, POSTGRES)
+	defer teardown(t, db)
+	migrations = []migration{
+		{
+			Version: 1,
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
+		},
+		{
+			Version: 2,
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
+		},
+	}
+	if _, _, err := RunTo(db, 1, POSTGRES); err != nil {
+		t.Error(err.Error())
+	}
+
+	err := CheckVersion(db, POSTGRES)
+	if err == nil {
+		t.Error("Expected a version mismatch error")
+	}
+	mismatch, ok := err.(*ErrVersionMismatch)
+	if !ok {
+		t.Fatalf("Expected *ErrVersionMismatch, got %T", err)
+	}
+	if mismatch.Expected != 2 || mismatch.Actual != 1 {
+		t.Errorf("Expected mismatch of 1 -> 2, got %d -> %d", mismatch.Actual, mismatch.Expected)
+	}
+}
+
+func TestRunToUpMultiStep(t *testing.T) {
+	db := connect(t, POSTGRES)
+	defer teardown(t, db)
+	migrations = []migration{
+		{
+			Version: 1,
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
+		},
+		{
+			Version: 2,
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
+		},
+		{
+			Version: 3,
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
+		},
+	}
+	didChange, newVersion, err := RunTo(db, 2, POSTGRES)
+	if !didChange {
+		t.Error("Expected to change version")
+	}
+	if newVersion != 2 {
+		t.Error("Expected new version to be 2")
+	}
+	if err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestRunToDownMultiStep(t *testing.T) {
+	db := connect(t, POSTGRES)
+	defer teardown(t, db)
+	migrations = []migration{
+		{
+			Version: 1,
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
+		},
+		{
+			Version: 2,
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
+		},
+	}
+	RunTo(db, 2, POSTGRES) // migrate to version 2
+	didChange, newVersion, err := RunTo(db, 0, POSTGRES)
+	if !didChange {
+		t.Error("Expected to change version")
+	}
+	if newVersion != 0 {
+		t.Error("Expected new version to be 0")
+	}
+	if err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestRunToDownMultiStepSparseVersions(t *testing.T) {
+	db := connect(t, POSTGRES)
+	defer teardown(t, db)
+	migrations = []migration{
+		{
+			Version: 100,
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
+		},
+		{
+			Version: 200,
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
+		},
+		{
+			Version: 300,
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
+		},
+	}
+	RunTo(db, 300, POSTGRES) // migrate to version 300
+	didChange, newVersion, err := RunTo(db, 100, POSTGRES)
+	if !didChange {
+		t.Error("Expected to change version")
+	}
+	if newVersion != 100 {
+		t.Errorf("Expected new version to be 100, got %d", newVersion)
+	}
+	if err != nil {
+		t.Error(err.Error())
+	}
+
+	statuses, err := Status(db, POSTGRES)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if !statuses[0].Applied {
+		t.Error("Expected version 100 to remain applied")
+	}
+}
+
+func TestRunToSameVersion(t *testing.T) {
+	db := connect(t, POSTGRES)
+	defer teardown(t, db)
+	migrations = []migration{
+		{
+			Version: 1,
+			Up:      func(context.Context, *sql.Tx) error { return nil },
+			Down:    func(context.Context, *sql.Tx) error { return nil },
+		},
+	}
+	RunTo(db, 1, POSTGRES) // migrate to version 1
+	didChange, newVersion, err := RunTo(db, 1, POSTGRES)
+	if didChange {
+		t.Error("Expected not to change version")
+	}
+	if newVersion != 1 {
+		t.Error("Expected new version to be 1")
+	}
+	if err != nil {
+		t.Error(err.Error())
+	}
+}
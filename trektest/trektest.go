@@ -0,0 +1,43 @@
+// Package trektest provides test helpers for asserting that a database's
+// schema matches what its migrations are expected to produce.
+package trektest
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/ivancevich/trek"
+)
+
+// AssertSchemaMatches snapshots db's schema with trek.SnapshotSchema and
+// compares it against the golden file at goldenPath, failing t if they
+// differ. options are forwarded to trek.SnapshotSchema, so pass the same
+// Database option used with Run (e.g. trek.MYSQL) when db isn't Postgres.
+// Set the TREK_UPDATE_GOLDEN environment variable to a non-empty value to
+// (re)write goldenPath from the current schema instead of comparing against
+// it.
+func AssertSchemaMatches(t *testing.T, db *sql.DB, goldenPath string, options ...string) {
+	t.Helper()
+
+	actual, err := trek.SnapshotSchema(db, options...)
+	if err != nil {
+		t.Fatalf("trektest: snapshotting schema: %s", err)
+	}
+
+	if os.Getenv("TREK_UPDATE_GOLDEN") != "" {
+		if err := os.WriteFile(goldenPath, []byte(actual), 0o644); err != nil {
+			t.Fatalf("trektest: writing golden file: %s", err)
+		}
+		return
+	}
+
+	expected, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("trektest: reading golden file: %s", err)
+	}
+
+	if actual != string(expected) {
+		t.Errorf("trektest: schema does not match %s\n--- expected ---\n%s--- actual ---\n%s", goldenPath, expected, actual)
+	}
+}